@@ -0,0 +1,69 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cdd
+
+// ActionCode enumerates the reasons a user can cause a job to stop.
+type ActionCode string
+
+const ActionCancelled ActionCode = "CANCELLED"
+
+// UserActionCause describes a job state transition caused by the user, e.g.
+// cancelling the job at the printer.
+type UserActionCause struct {
+	ActionCode ActionCode
+}
+
+// DeviceActionCause describes a job state transition caused by the device
+// itself, e.g. running out of paper. ErrorCode reuses the same enum
+// PrinterStateSection uses to describe device conditions.
+type DeviceActionCause struct {
+	ErrorCode ErrorCode
+}
+
+// ServiceErrorCode enumerates the reasons the connector itself can stop a
+// job, as opposed to the device or the user.
+type ServiceErrorCode string
+
+const (
+	ServiceErrorOther          ServiceErrorCode = "OTHER"
+	ServiceErrorInvalidTicket  ServiceErrorCode = "INVALID_TICKET"
+	ServiceErrorPrinterDeleted ServiceErrorCode = "PRINTER_DELETED"
+)
+
+// ServiceActionCause describes a job state transition caused by the
+// connector, e.g. failing to parse a ticket.
+type ServiceActionCause struct {
+	ErrorCode ServiceErrorCode
+}
+
+// JobState is a job's state plus, when the state isn't a plain success, the
+// structured reason it got there. At most one of the *ActionCause fields is
+// set.
+type JobState struct {
+	Type JobStateType
+
+	UserActionCause    *UserActionCause    `json:",omitempty"`
+	DeviceActionCause  *DeviceActionCause  `json:",omitempty"`
+	ServiceActionCause *ServiceActionCause `json:",omitempty"`
+}
+
+// PrintJobStateDiff is the unit gcp.Control sends to GCP, serialized as a
+// semantic_state_diff, in place of the free-form status/message strings the
+// connector used to push.
+type PrintJobStateDiff struct {
+	State JobState
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cdd implements the pieces of GCP's Cloud Device Description that
+// the connector needs to report structured printer and job state, instead
+// of the free-form strings GCP historically accepted.
+package cdd
+
+// JobStateType is the canonical set of states a job can be in, per the CDD
+// semantic_state schema.
+type JobStateType string
+
+const (
+	JobStateQueued     JobStateType = "QUEUED"
+	JobStateInProgress JobStateType = "IN_PROGRESS"
+	JobStateStopped    JobStateType = "STOPPED"
+	JobStateDone       JobStateType = "DONE"
+	JobStateAborted    JobStateType = "ABORTED"
+)
+
+// ErrorCode enumerates the device conditions CDD knows how to describe.
+type ErrorCode string
+
+const (
+	ErrorNoToner    ErrorCode = "NO_TONER"
+	ErrorOutOfInk   ErrorCode = "OUT_OF_INK"
+	ErrorOutOfPaper ErrorCode = "OUT_OF_PAPER"
+	ErrorDoorOpen   ErrorCode = "DOOR_OPEN"
+	ErrorJammed     ErrorCode = "JAMMED"
+)
+
+// MarkerState describes one marker (toner or ink cartridge) as reported by
+// Printer-MIB's prtMarkerSuppliesTable.
+type MarkerState struct {
+	VendorID     string
+	Type         string // e.g. "toner", "ink"
+	LevelPercent int
+	State        string // "OK", "EXHAUSTED", etc.
+}
+
+// InputTrayState describes one input tray as reported by Printer-MIB's
+// prtInputTable.
+type InputTrayState struct {
+	VendorID     string
+	LevelPercent int
+	State        string
+}
+
+// PrinterStateSection is the structured device state the connector sends to
+// GCP alongside a printer's capabilities. A non-empty JobState/ErrorCode
+// means the device itself is blocking progress, independent of any single
+// job's status.
+type PrinterStateSection struct {
+	Markers     []MarkerState
+	InputTrays  []InputTrayState
+	VendorState []string // human-readable vendor messages, e.g. prtAlertDescription
+
+	JobState  JobStateType
+	ErrorCode ErrorCode
+}
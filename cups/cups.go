@@ -0,0 +1,90 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package cups drives the local cupsd through its standard command-line
+// tools: listing and printing to printers, and polling job status.
+package cups
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"cups-connector/lib"
+
+	"github.com/golang/glog"
+)
+
+const ppdDir = "/etc/cups/ppd"
+
+// CUPS is a thin wrapper around the system's cupsd.
+type CUPS struct{}
+
+// NewCUPS constructs a CUPS that talks to the local cupsd.
+func NewCUPS() *CUPS {
+	return &CUPS{}
+}
+
+// GetPrinters lists every printer cupsd currently knows about.
+func (c *CUPS) GetPrinters() ([]lib.Printer, error) {
+	out, err := exec.Command("lpstat", "-v").Output()
+	if err != nil {
+		return nil, fmt.Errorf("cups: failed to call lpstat -v: %s", err)
+	}
+
+	var printers []lib.Printer
+	for _, line := range strings.Split(string(out), "\n") {
+		// lpstat -v prints one line per printer: "device for <name>: <deviceURI>"
+		line = strings.TrimPrefix(line, "device for ")
+		name, deviceURI, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		printer := lib.Printer{Name: name, DeviceURI: deviceURI}
+		if ppd, err := c.GetPPD(name); err != nil {
+			glog.Warningf("Failed to read PPD for %s while listing printers: %s", name, err)
+		} else {
+			printer.CapsHash = hashPPD(ppd)
+		}
+		printers = append(printers, printer)
+	}
+	return printers, nil
+}
+
+// GetPPD returns the raw PPD cupsd has on file for printerName.
+func (c *CUPS) GetPPD(printerName string) (string, error) {
+	ppd, err := ioutil.ReadFile(ppdDir + "/" + printerName + ".ppd")
+	if err != nil {
+		return "", fmt.Errorf("cups: failed to read PPD for %s: %s", printerName, err)
+	}
+	return string(ppd), nil
+}
+
+// hashPPD returns a hex-encoded sha1 of ppd's content, so that callers can
+// cheaply detect a capabilities change without diffing the whole document.
+func hashPPD(ppd string) string {
+	sum := sha1.Sum([]byte(ppd))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateTempFile creates a temp file to download a job's document into.
+func (c *CUPS) CreateTempFile() (*os.File, error) {
+	return ioutil.TempFile("", "cups-connector-")
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package cups
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+
+	"cups-connector/cdd"
+)
+
+// Print submits filename to printerName via the CUPS `lp` command and
+// returns the CUPS job ID it was assigned.
+func (c *CUPS) Print(printerName, filename, title, owner, options string) (uint32, error) {
+	args := []string{"-d", printerName, "-t", title, "-U", owner}
+	for _, option := range strings.Fields(options) {
+		args = append(args, "-o", option)
+	}
+	args = append(args, filename)
+
+	out, err := exec.Command("lp", args...).Output()
+	if err != nil {
+		return 0, fmt.Errorf("cups: failed to call lp for %s: %s", filename, err)
+	}
+
+	// lp prints e.g. "request id is office-printer-42 (1 file(s))".
+	fields := strings.Fields(string(out))
+	var requestID string
+	for i, field := range fields {
+		if field == "id" && i+2 < len(fields) && fields[i+1] == "is" {
+			requestID = fields[i+2]
+			break
+		}
+	}
+	idx := strings.LastIndex(requestID, "-")
+	if idx < 0 {
+		return 0, fmt.Errorf("cups: failed to parse job ID from lp output: %s", out)
+	}
+	jobID, err := strconv.ParseUint(requestID[idx+1:], 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("cups: failed to parse job ID from lp output: %s", out)
+	}
+	return uint32(jobID), nil
+}
+
+// GetJobStatus polls cupsJobID's current IPP job-state and job-state-reasons
+// and turns them into a cdd.PrintJobStateDiff, so that callers deal in GCP's
+// structured state instead of CUPS/IPP's.
+func (c *CUPS) GetJobStatus(cupsJobID uint32) (cdd.PrintJobStateDiff, error) {
+	out, err := exec.Command("lpstat", "-l", "-o", strconv.FormatUint(uint64(cupsJobID), 10)).Output()
+	if err != nil {
+		return cdd.PrintJobStateDiff{}, fmt.Errorf("cups: failed to call lpstat for job %d: %s", cupsJobID, err)
+	}
+
+	ippState, reasons := parseJobStatus(string(out))
+	return diffFromIPPState(ippState, reasons), nil
+}
+
+// parseJobStatus pulls the IPP job-state keyword and any job-state-reasons
+// keywords out of lpstat -l's free-form output.
+func parseJobStatus(lpstatOutput string) (state string, reasons []string) {
+	for _, line := range strings.Split(lpstatOutput, "\n") {
+		line = strings.TrimSpace(line)
+		switch {
+		case strings.HasPrefix(line, "Status:"):
+			state = strings.TrimSpace(strings.TrimPrefix(line, "Status:"))
+		case strings.HasSuffix(line, "-reasons") || strings.HasPrefix(line, "job-"):
+			reasons = append(reasons, line)
+		}
+	}
+	return state, reasons
+}
+
+// diffFromIPPState maps an IPP job-state plus job-state-reasons keywords to
+// the CDD job state our callers understand, picking out the specific cause
+// GCP should show the user.
+func diffFromIPPState(ippState string, reasons []string) cdd.PrintJobStateDiff {
+	for _, reason := range reasons {
+		switch {
+		case strings.Contains(reason, "media-empty"):
+			return stoppedBy(cdd.DeviceActionCause{ErrorCode: cdd.ErrorOutOfPaper})
+		case strings.Contains(reason, "media-jam"):
+			return stoppedBy(cdd.DeviceActionCause{ErrorCode: cdd.ErrorJammed})
+		case strings.Contains(reason, "cover-open") || strings.Contains(reason, "door-open"):
+			return stoppedBy(cdd.DeviceActionCause{ErrorCode: cdd.ErrorDoorOpen})
+		case strings.Contains(reason, "marker-supply-empty") || strings.Contains(reason, "toner-empty"):
+			return stoppedBy(cdd.DeviceActionCause{ErrorCode: cdd.ErrorNoToner})
+		case strings.Contains(reason, "canceled-by-user"):
+			return cdd.PrintJobStateDiff{State: cdd.JobState{
+				Type:            cdd.JobStateAborted,
+				UserActionCause: &cdd.UserActionCause{ActionCode: cdd.ActionCancelled},
+			}}
+		case strings.Contains(reason, "held-for-authentication") || strings.Contains(reason, "held-for-review"):
+			return cdd.PrintJobStateDiff{State: cdd.JobState{
+				Type:               cdd.JobStateStopped,
+				ServiceActionCause: &cdd.ServiceActionCause{ErrorCode: cdd.ServiceErrorOther},
+			}}
+		}
+	}
+
+	switch ippState {
+	case "completed":
+		return cdd.PrintJobStateDiff{State: cdd.JobState{Type: cdd.JobStateDone}}
+	case "canceled", "aborted":
+		return cdd.PrintJobStateDiff{State: cdd.JobState{Type: cdd.JobStateAborted}}
+	case "held":
+		return cdd.PrintJobStateDiff{State: cdd.JobState{Type: cdd.JobStateQueued}}
+	case "processing":
+		return cdd.PrintJobStateDiff{State: cdd.JobState{Type: cdd.JobStateInProgress}}
+	default:
+		return cdd.PrintJobStateDiff{State: cdd.JobState{Type: cdd.JobStateQueued}}
+	}
+}
+
+func stoppedBy(cause cdd.DeviceActionCause) cdd.PrintJobStateDiff {
+	return cdd.PrintJobStateDiff{State: cdd.JobState{
+		Type:              cdd.JobStateStopped,
+		DeviceActionCause: &cause,
+	}}
+}
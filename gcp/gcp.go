@@ -0,0 +1,254 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package gcp is a thin client for the Google Cloud Print API: registering,
+// updating, and listing printers, and fetching and controlling print jobs.
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"cups-connector/cdd"
+	"cups-connector/lib"
+
+	"github.com/golang/glog"
+)
+
+const apiBase = "https://www.google.com/cloudprint"
+
+// GoogleCloudPrint is a thin, authenticated client for the GCP API. One
+// instance is shared by every goroutine that talks to GCP.
+type GoogleCloudPrint struct {
+	proxyName   string
+	client      *http.Client
+	accessToken func() (string, error)
+}
+
+// NewGoogleCloudPrint constructs a client that identifies itself as
+// proxyName and authenticates every request with a fresh token from
+// accessToken.
+func NewGoogleCloudPrint(proxyName string, accessToken func() (string, error)) *GoogleCloudPrint {
+	return &GoogleCloudPrint{
+		proxyName:   proxyName,
+		client:      &http.Client{},
+		accessToken: accessToken,
+	}
+}
+
+type apiResponse struct {
+	Success bool   `json:"success"`
+	Message string `json:"message"`
+}
+
+// post issues an authenticated POST to GCP's API and returns the raw
+// response body, after checking the transport-level (HTTP status) success
+// of the call. The GCP-level success field in the body is not checked here;
+// callers parse and check it.
+func (g *GoogleCloudPrint) post(path string, form url.Values) ([]byte, error) {
+	token, err := g.accessToken()
+	if err != nil {
+		return nil, fmt.Errorf("gcp: failed to get an access token: %s", err)
+	}
+
+	req, err := http.NewRequest("POST", apiBase+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawQuery = form.Encode()
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: %s request failed: %s", path, err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("gcp: failed to read %s response: %s", path, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("gcp: %s returned HTTP %d: %s", path, resp.StatusCode, body)
+	}
+	return body, nil
+}
+
+type printerListResponse struct {
+	apiResponse
+	Printers []struct {
+		ID                 string `json:"id"`
+		Name               string `json:"name"`
+		DefaultDisplayName string `json:"defaultDisplayName"`
+		CapsHash           string `json:"capsHash"`
+		QueuedJobsCount    uint   `json:"numberOfDocuments"`
+	} `json:"printers"`
+}
+
+// List fetches every printer GCP currently has registered for this
+// connector's proxy.
+func (g *GoogleCloudPrint) List() ([]lib.Printer, error) {
+	body, err := g.post("/list", url.Values{"proxy": {g.proxyName}})
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed printerListResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("gcp: failed to parse /list response: %s", err)
+	}
+	if !parsed.Success {
+		return nil, fmt.Errorf("gcp: /list failed: %s", parsed.Message)
+	}
+
+	printers := make([]lib.Printer, len(parsed.Printers))
+	for i, p := range parsed.Printers {
+		printers[i] = lib.Printer{
+			GCPID:              p.ID,
+			Name:               p.Name,
+			DefaultDisplayName: p.DefaultDisplayName,
+			CapsHash:           p.CapsHash,
+			QueuedJobsCount:    p.QueuedJobsCount,
+		}
+	}
+	return printers, nil
+}
+
+// Register creates printer in GCP using ppd as its capabilities, and fills
+// in printer.GCPID with the ID GCP assigned it.
+func (g *GoogleCloudPrint) Register(printer *lib.Printer, ppd string) error {
+	form := url.Values{
+		"proxy":                {g.proxyName},
+		"name":                 {printer.Name},
+		"default_display_name": {printer.DefaultDisplayName},
+		"capabilities":         {ppd},
+	}
+	body, err := g.post("/register", form)
+	if err != nil {
+		return err
+	}
+
+	var parsed struct {
+		apiResponse
+		Printers []struct {
+			ID string `json:"id"`
+		} `json:"printers"`
+	}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("gcp: failed to parse /register response: %s", err)
+	}
+	if !parsed.Success || len(parsed.Printers) == 0 {
+		return fmt.Errorf("gcp: /register failed: %s", parsed.Message)
+	}
+
+	printer.GCPID = parsed.Printers[0].ID
+	return nil
+}
+
+// Update pushes diff's printer state (capabilities, display name, SNMP-
+// derived semantic state, etc.) to GCP. ppd is non-empty only when the
+// printer's capabilities changed.
+func (g *GoogleCloudPrint) Update(diff *lib.PrinterDiff, ppd string) error {
+	form := url.Values{
+		"printerid":            {diff.Printer.GCPID},
+		"default_display_name": {diff.Printer.DefaultDisplayName},
+	}
+	if ppd != "" {
+		form.Set("capabilities", ppd)
+	}
+	if semanticState, ok := marshalSemanticState(diff.Printer.State); ok {
+		form.Set("semantic_state", semanticState)
+	}
+
+	body, err := g.post("/update", form)
+	if err != nil {
+		return err
+	}
+
+	var parsed apiResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("gcp: failed to parse /update response: %s", err)
+	}
+	if !parsed.Success {
+		return fmt.Errorf("gcp: /update failed: %s", parsed.Message)
+	}
+	return nil
+}
+
+// marshalSemanticState JSON-encodes state for GCP's semantic_state field,
+// returning ok=false when state carries nothing worth reporting (e.g. SNMP
+// polling is disabled or hasn't run yet for this printer).
+func marshalSemanticState(state cdd.PrinterStateSection) (string, bool) {
+	if len(state.Markers) == 0 && len(state.InputTrays) == 0 && len(state.VendorState) == 0 && state.JobState == "" {
+		return "", false
+	}
+
+	b, err := json.Marshal(state)
+	if err != nil {
+		glog.Errorf("gcp: failed to marshal printer semantic state: %s", err)
+		return "", false
+	}
+	return string(b), true
+}
+
+// Delete removes gcpID from GCP entirely.
+func (g *GoogleCloudPrint) Delete(gcpID string) error {
+	body, err := g.post("/delete", url.Values{"printerid": {gcpID}})
+	if err != nil {
+		return err
+	}
+
+	var parsed apiResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("gcp: failed to parse /delete response: %s", err)
+	}
+	if !parsed.Success {
+		return fmt.Errorf("gcp: /delete failed: %s", parsed.Message)
+	}
+	return nil
+}
+
+// CanShare reports whether this connector's GCP account is permitted to
+// share printers with other users. It always returns true; the account's
+// type is not checked.
+func (g *GoogleCloudPrint) CanShare() bool {
+	return true
+}
+
+// Share grants the public "anyone with the link can print" role to gcpID.
+func (g *GoogleCloudPrint) Share(gcpID string) error {
+	form := url.Values{
+		"printerid": {gcpID},
+		"role":      {"USER"},
+		"public":    {"true"},
+	}
+	body, err := g.post("/share", form)
+	if err != nil {
+		return err
+	}
+
+	var parsed apiResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("gcp: failed to parse /share response: %s", err)
+	}
+	if !parsed.Success {
+		return fmt.Errorf("gcp: /share failed: %s", parsed.Message)
+	}
+	return nil
+}
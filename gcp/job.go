@@ -0,0 +1,159 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package gcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"cups-connector/cdd"
+	"cups-connector/lib"
+)
+
+type jobListResponse struct {
+	apiResponse
+	Jobs []struct {
+		ID        string `json:"id"`
+		PrinterID string `json:"printerid"`
+		OwnerID   string `json:"ownerId"`
+		TicketURL string `json:"ticketUrl"`
+		FileURL   string `json:"fileUrl"`
+	} `json:"jobs"`
+}
+
+// Fetch returns every job currently queued for gcpID. It's called once per
+// XMPP new-job notification, so unlike the old polling API it doesn't block
+// waiting for jobs to appear.
+func (g *GoogleCloudPrint) Fetch(gcpID string) ([]lib.Job, error) {
+	body, err := g.post("/fetch", url.Values{"printerid": {gcpID}})
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed jobListResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, fmt.Errorf("gcp: failed to parse /fetch response: %s", err)
+	}
+	if !parsed.Success {
+		return nil, fmt.Errorf("gcp: /fetch failed: %s", parsed.Message)
+	}
+
+	jobs := make([]lib.Job, len(parsed.Jobs))
+	for i, j := range parsed.Jobs {
+		jobs[i] = lib.Job{
+			GCPPrinterID: j.PrinterID,
+			GCPJobID:     j.ID,
+			OwnerID:      j.OwnerID,
+			TicketURL:    j.TicketURL,
+			FileURL:      j.FileURL,
+		}
+	}
+	return jobs, nil
+}
+
+// Ticket fetches and returns the raw CJT (Cloud Job Ticket) at ticketURL, in
+// the form cups.Print expects as its options argument.
+func (g *GoogleCloudPrint) Ticket(ticketURL string) (string, error) {
+	body, err := g.getAuthenticated(ticketURL)
+	if err != nil {
+		return "", fmt.Errorf("gcp: failed to fetch ticket: %s", err)
+	}
+	return string(body), nil
+}
+
+// Download streams the print-ready document at fileURL into w.
+func (g *GoogleCloudPrint) Download(w io.Writer, fileURL string) error {
+	token, err := g.accessToken()
+	if err != nil {
+		return fmt.Errorf("gcp: failed to get an access token: %s", err)
+	}
+
+	req, err := http.NewRequest("GET", fileURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("gcp: failed to download %s: %s", fileURL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("gcp: download of %s returned HTTP %d", fileURL, resp.StatusCode)
+	}
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("gcp: failed to write downloaded document: %s", err)
+	}
+	return nil
+}
+
+// Control reports a job's structured state transition to GCP.
+func (g *GoogleCloudPrint) Control(gcpJobID string, diff cdd.PrintJobStateDiff) error {
+	semanticStateDiff, err := json.Marshal(diff)
+	if err != nil {
+		return fmt.Errorf("gcp: failed to marshal job state diff for %s: %s", gcpJobID, err)
+	}
+
+	form := url.Values{
+		"jobid":               {gcpJobID},
+		"semantic_state_diff": {string(semanticStateDiff)},
+	}
+	body, err := g.post("/control", form)
+	if err != nil {
+		return err
+	}
+
+	var parsed apiResponse
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return fmt.Errorf("gcp: failed to parse /control response: %s", err)
+	}
+	if !parsed.Success {
+		return fmt.Errorf("gcp: /control failed for job %s: %s", gcpJobID, parsed.Message)
+	}
+	return nil
+}
+
+// getAuthenticated issues an authenticated GET to rawURL and returns the raw
+// response body.
+func (g *GoogleCloudPrint) getAuthenticated(rawURL string) ([]byte, error) {
+	token, err := g.accessToken()
+	if err != nil {
+		return nil, fmt.Errorf("gcp: failed to get an access token: %s", err)
+	}
+
+	req, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s returned HTTP %d", rawURL, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,108 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import "sync"
+
+// ConcurrentPrinterMap is a map of CUPS printer name to Printer, safe for
+// concurrent reads (from job-processing goroutines) and wholesale
+// replacement (from the printer sync goroutine). It's keyed by CUPS name
+// rather than GCPID because GCPID is empty until a printer is registered
+// with GCP, and stays empty forever in local-only mode, which would
+// collapse every printer onto the same map entry.
+type ConcurrentPrinterMap struct {
+	mutex    sync.RWMutex
+	printers map[string]Printer // keyed by CUPS printer name
+	byGCPID  map[string]string  // GCPID -> CUPS printer name, for jobs fetched from GCP
+}
+
+// NewConcurrentPrinterMap builds a ConcurrentPrinterMap seeded with printers.
+func NewConcurrentPrinterMap(printers []Printer) *ConcurrentPrinterMap {
+	cpm := &ConcurrentPrinterMap{
+		printers: make(map[string]Printer, len(printers)),
+		byGCPID:  make(map[string]string, len(printers)),
+	}
+	for _, p := range printers {
+		cpm.printers[p.Name] = p
+		if p.GCPID != "" {
+			cpm.byGCPID[p.GCPID] = p.Name
+		}
+	}
+	return cpm
+}
+
+// Get returns the printer with the given CUPS name, if any.
+func (cpm *ConcurrentPrinterMap) Get(name string) (Printer, bool) {
+	cpm.mutex.RLock()
+	defer cpm.mutex.RUnlock()
+	p, exists := cpm.printers[name]
+	return p, exists
+}
+
+// GetByGCPID returns the printer registered under gcpID, if any. Used to
+// resolve jobs fetched from GCP, which only carry the remote GCPID rather
+// than the CUPS printer name.
+func (cpm *ConcurrentPrinterMap) GetByGCPID(gcpID string) (Printer, bool) {
+	cpm.mutex.RLock()
+	defer cpm.mutex.RUnlock()
+	name, exists := cpm.byGCPID[gcpID]
+	if !exists {
+		return Printer{}, false
+	}
+	p, exists := cpm.printers[name]
+	return p, exists
+}
+
+// GetAll returns every printer currently in the map.
+func (cpm *ConcurrentPrinterMap) GetAll() []Printer {
+	cpm.mutex.RLock()
+	defer cpm.mutex.RUnlock()
+	s := make([]Printer, 0, len(cpm.printers))
+	for _, p := range cpm.printers {
+		s = append(s, p)
+	}
+	return s
+}
+
+// Set replaces the single entry for printer.Name, leaving every other
+// printer in the map untouched. It's used to merge in-place updates (e.g.
+// freshly-polled SNMP state) that don't warrant a full Refresh.
+func (cpm *ConcurrentPrinterMap) Set(printer Printer) {
+	cpm.mutex.Lock()
+	defer cpm.mutex.Unlock()
+	cpm.printers[printer.Name] = printer
+	if printer.GCPID != "" {
+		cpm.byGCPID[printer.GCPID] = printer.Name
+	}
+}
+
+// Refresh atomically replaces the map's contents with newPrinters.
+func (cpm *ConcurrentPrinterMap) Refresh(newPrinters []Printer) {
+	printers := make(map[string]Printer, len(newPrinters))
+	byGCPID := make(map[string]string, len(newPrinters))
+	for _, p := range newPrinters {
+		printers[p.Name] = p
+		if p.GCPID != "" {
+			byGCPID[p.GCPID] = p.Name
+		}
+	}
+
+	cpm.mutex.Lock()
+	defer cpm.mutex.Unlock()
+	cpm.printers = printers
+	cpm.byGCPID = byGCPID
+}
@@ -0,0 +1,106 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package lib
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentPrinterMapLocalOnlyPrintersDontCollide(t *testing.T) {
+	cpm := NewConcurrentPrinterMap([]Printer{
+		{Name: "printer1"},
+		{Name: "printer2"},
+	})
+
+	p1, exists := cpm.Get("printer1")
+	if !exists || p1.Name != "printer1" {
+		t.Fatalf("Get(printer1) = %+v, %v", p1, exists)
+	}
+	p2, exists := cpm.Get("printer2")
+	if !exists || p2.Name != "printer2" {
+		t.Fatalf("Get(printer2) = %+v, %v", p2, exists)
+	}
+}
+
+func TestConcurrentPrinterMapGetByGCPID(t *testing.T) {
+	cpm := NewConcurrentPrinterMap([]Printer{
+		{Name: "printer1", GCPID: "gcp1"},
+		{Name: "printer2"},
+	})
+
+	p, exists := cpm.GetByGCPID("gcp1")
+	if !exists || p.Name != "printer1" {
+		t.Fatalf("GetByGCPID(gcp1) = %+v, %v", p, exists)
+	}
+	if _, exists := cpm.GetByGCPID(""); exists {
+		t.Fatal("GetByGCPID(\"\") should never match a local-only printer")
+	}
+}
+
+func TestConcurrentPrinterMapSetUpdatesGCPIDIndex(t *testing.T) {
+	cpm := NewConcurrentPrinterMap([]Printer{{Name: "printer1"}})
+
+	cpm.Set(Printer{Name: "printer1", GCPID: "gcp1"})
+
+	p, exists := cpm.GetByGCPID("gcp1")
+	if !exists || p.Name != "printer1" {
+		t.Fatalf("GetByGCPID(gcp1) after Set = %+v, %v", p, exists)
+	}
+}
+
+func TestConcurrentPrinterMapRefreshReplacesContents(t *testing.T) {
+	cpm := NewConcurrentPrinterMap([]Printer{{Name: "printer1", GCPID: "gcp1"}})
+
+	cpm.Refresh([]Printer{{Name: "printer2", GCPID: "gcp2"}})
+
+	if _, exists := cpm.Get("printer1"); exists {
+		t.Fatal("printer1 should be gone after Refresh")
+	}
+	if _, exists := cpm.GetByGCPID("gcp1"); exists {
+		t.Fatal("gcp1 should be gone after Refresh")
+	}
+	if p, exists := cpm.Get("printer2"); !exists || p.GCPID != "gcp2" {
+		t.Fatalf("Get(printer2) after Refresh = %+v, %v", p, exists)
+	}
+}
+
+// TestConcurrentPrinterMapConcurrentAccess exercises the race this map
+// exists to prevent: concurrent readers (job-processing goroutines) against
+// the writer (the printer sync goroutine) must never be observed by `go test
+// -race`.
+func TestConcurrentPrinterMapConcurrentAccess(t *testing.T) {
+	cpm := NewConcurrentPrinterMap([]Printer{{Name: "printer1", GCPID: "gcp1"}})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			cpm.Get("printer1")
+		}()
+		go func() {
+			defer wg.Done()
+			cpm.GetByGCPID("gcp1")
+		}()
+		go func(i int) {
+			defer wg.Done()
+			cpm.Set(Printer{Name: fmt.Sprintf("printer%d", i), GCPID: fmt.Sprintf("gcp%d", i)})
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,45 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+// Job state strings used by Privet's local job-state store. Cloud jobs
+// report state to GCP as a cdd.PrintJobStateDiff instead; these values are
+// kept as plain strings so Privet's /privet/printer/jobstate handler doesn't
+// need to depend on cdd.
+const (
+	JobQueued     = "QUEUED"
+	JobInProgress = "IN_PROGRESS"
+	JobDone       = "DONE"
+	JobError      = "ERROR"
+)
+
+// Job is a unit of work handed to PrinterManager.processJob, whether fetched
+// from GCP's job queue for one printer or submitted locally over Privet.
+type Job struct {
+	GCPPrinterID string
+	GCPJobID     string
+	OwnerID      string
+	TicketURL    string
+	FileURL      string
+
+	// PrivetJobID is set, and TicketURL/FileURL are unused, for jobs
+	// submitted locally: PDF already holds the document, and job state
+	// is reported back through the Privet job-state store instead of
+	// GCP's /control.
+	PrivetJobID string
+	PDF         []byte
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+import "cups-connector/cdd"
+
+// Printer is this connector's view of one printer, reconciled between CUPS
+// and GCP.
+type Printer struct {
+	GCPID              string
+	Name               string
+	DefaultDisplayName string
+	DeviceURI          string
+	CapsHash           string
+	QueuedJobsCount    uint
+	State              cdd.PrinterStateSection
+	CUPSJobSemaphore   *Semaphore
+}
+
+// Operation is the action DiffPrinters decided a printer needs.
+type Operation uint8
+
+const (
+	RegisterPrinter Operation = iota
+	UpdatePrinter
+	DeletePrinter
+	LeavePrinter
+)
+
+// PrinterDiff is one printer's required Operation, plus enough of its new
+// state to carry it out.
+type PrinterDiff struct {
+	Operation       Operation
+	Printer         Printer
+	CapsHashChanged bool
+}
+
+// DiffPrinters compares CUPS's current printers against GCP's last-known
+// view of them and returns the operations needed to reconcile the two. Every
+// CUPS printer gets a diff, even an unchanged one (as LeavePrinter), since
+// the caller uses the returned set wholesale to refresh its view of every
+// known printer.
+func DiffPrinters(cupsPrinters, gcpPrinters []Printer) []PrinterDiff {
+	if len(cupsPrinters) == 0 && len(gcpPrinters) == 0 {
+		return nil
+	}
+
+	gcpByName := make(map[string]Printer, len(gcpPrinters))
+	for _, p := range gcpPrinters {
+		gcpByName[p.Name] = p
+	}
+
+	var diffs []PrinterDiff
+	seen := make(map[string]bool, len(cupsPrinters))
+	for _, cupsPrinter := range cupsPrinters {
+		seen[cupsPrinter.Name] = true
+		gcpPrinter, exists := gcpByName[cupsPrinter.Name]
+		if !exists {
+			diffs = append(diffs, PrinterDiff{Operation: RegisterPrinter, Printer: cupsPrinter})
+			continue
+		}
+
+		capsHashChanged := cupsPrinter.CapsHash != gcpPrinter.CapsHash
+		if capsHashChanged || cupsPrinter.DefaultDisplayName != gcpPrinter.DefaultDisplayName || cupsPrinter.DeviceURI != gcpPrinter.DeviceURI {
+			updated := gcpPrinter
+			updated.DefaultDisplayName = cupsPrinter.DefaultDisplayName
+			updated.DeviceURI = cupsPrinter.DeviceURI
+			updated.CapsHash = cupsPrinter.CapsHash
+			diffs = append(diffs, PrinterDiff{Operation: UpdatePrinter, Printer: updated, CapsHashChanged: capsHashChanged})
+			continue
+		}
+
+		diffs = append(diffs, PrinterDiff{Operation: LeavePrinter, Printer: gcpPrinter})
+	}
+
+	for _, gcpPrinter := range gcpPrinters {
+		if !seen[gcpPrinter.Name] {
+			diffs = append(diffs, PrinterDiff{Operation: DeletePrinter, Printer: gcpPrinter})
+		}
+	}
+
+	return diffs
+}
@@ -0,0 +1,43 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lib
+
+// Semaphore bounds how many callers can hold a resource concurrently.
+type Semaphore struct {
+	c chan struct{}
+}
+
+// NewSemaphore constructs a Semaphore that allows up to max concurrent
+// holders.
+func NewSemaphore(max uint) *Semaphore {
+	return &Semaphore{c: make(chan struct{}, max)}
+}
+
+// Acquire blocks until a slot is available.
+func (s *Semaphore) Acquire() {
+	s.c <- struct{}{}
+}
+
+// Release frees a slot acquired with Acquire.
+func (s *Semaphore) Release() {
+	<-s.c
+}
+
+// Count returns the number of slots currently held.
+func (s *Semaphore) Count() uint {
+	return uint(len(s.c))
+}
@@ -16,145 +16,345 @@ limitations under the License.
 package manager
 
 import (
+	"cups-connector/cdd"
 	"cups-connector/cups"
 	"cups-connector/gcp"
 	"cups-connector/lib"
+	"cups-connector/privet"
+	"cups-connector/snmp"
+	"cups-connector/xmpp"
 	"fmt"
 	"os"
+	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/glog"
 )
 
-// Manages all interactions between CUPS and Google Cloud Print.
+// Manages all interactions between CUPS, Google Cloud Print, and Privet.
 type PrinterManager struct {
-	cups               *cups.CUPS
-	gcp                *gcp.GoogleCloudPrint
-	gcpPrintersByGCPID map[string]lib.Printer
-	gcpJobPollQuit     chan bool
-	printerPollQuit    chan bool
-	downloadSemaphore  *lib.Semaphore
-	jobStatsSemaphore  *lib.Semaphore
-	jobsDone           uint
-	jobsError          uint
-	cupsQueueSize      uint
-	jobPollInterval    time.Duration
-	jobFullUsername    bool
+	cups              *cups.CUPS
+	gcp               *gcp.GoogleCloudPrint
+	xmpp              *xmpp.Client
+	xmppNotifications <-chan xmpp.PrinterNotification
+	privet            *privet.Privet
+	snmp              *snmp.SNMPManager
+	jobs              chan *lib.Job
+	gcpPrinters       *lib.ConcurrentPrinterMap
+	quit              chan struct{}
+	wg                sync.WaitGroup
+	shutdownTimeout   time.Duration
+	downloadSemaphore *lib.Semaphore
+	jobStatsMutex     sync.Mutex
+	jobsDone          uint
+	jobsError         uint
+	jobsInFlightMutex sync.Mutex
+	jobsInFlight      map[string]*lib.Job
+	cupsQueueSize     uint
+	jobPollInterval   time.Duration
+	snmpPollInterval  time.Duration
+	jobFullUsername   bool
 }
 
-func NewPrinterManager(cups *cups.CUPS, gcp *gcp.GoogleCloudPrint, printerPollInterval, jobPollInterval, gcpMaxConcurrentDownload, cupsQueueSize uint, jobFullUsername bool) (*PrinterManager, error) {
-	gcpPrinters, err := gcp.List()
-	if err != nil {
-		return nil, err
-	}
-	gcpPrintersByGCPID := make(map[string]lib.Printer, len(gcpPrinters))
-	for _, p := range gcpPrinters {
-		p.CUPSJobSemaphore = lib.NewSemaphore(cupsQueueSize)
-		gcpPrintersByGCPID[p.GCPID] = p
+// NewPrinterManager wires cups up to gcp and/or pvt. Either may be nil, but
+// not both: the connector needs at least one way to receive jobs, which the
+// caller enforces via the cloud_printing_enable/local_printing_enable
+// config flags before getting here. snmpManager is nil when snmp_enable is
+// false. shutdownTimeout bounds how long Quit waits for in-flight jobs to
+// finish before forcing them to stop.
+func NewPrinterManager(cups *cups.CUPS, gcp *gcp.GoogleCloudPrint, xmppClient *xmpp.Client, xmppNotifications <-chan xmpp.PrinterNotification, pvt *privet.Privet, snmpManager *snmp.SNMPManager, printerPollInterval, jobPollInterval, snmpPollInterval, gcpMaxConcurrentDownload, cupsQueueSize uint, jobFullUsername bool, shutdownTimeout time.Duration) (*PrinterManager, error) {
+	if gcp == nil && pvt == nil {
+		return nil, fmt.Errorf("cannot start: both cloud_printing_enable and local_printing_enable are false")
 	}
 
-	gcpJobPollQuit := make(chan bool)
-	printerPollQuit := make(chan bool)
+	var initialPrinters []lib.Printer
+	if gcp != nil {
+		gcpPrinters, err := gcp.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range gcpPrinters {
+			p.CUPSJobSemaphore = lib.NewSemaphore(cupsQueueSize)
+			initialPrinters = append(initialPrinters, p)
+		}
+	}
+	gcpPrinters := lib.NewConcurrentPrinterMap(initialPrinters)
 
+	quit := make(chan struct{})
 	downloadSemaphore := lib.NewSemaphore(gcpMaxConcurrentDownload)
-	jobStatsSemaphore := lib.NewSemaphore(1)
 
 	jpi := time.Duration(jobPollInterval) * time.Second
+	spi := time.Duration(snmpPollInterval) * time.Second
+	jobs := make(chan *lib.Job, 10)
+	jobsInFlight := make(map[string]*lib.Job)
 
-	pm := PrinterManager{cups, gcp, gcpPrintersByGCPID, gcpJobPollQuit, printerPollQuit,
-		downloadSemaphore, jobStatsSemaphore, 0, 0, cupsQueueSize, jpi, jobFullUsername}
+	pm := PrinterManager{cups, gcp, xmppClient, xmppNotifications, pvt, snmpManager, jobs, gcpPrinters, quit, sync.WaitGroup{}, shutdownTimeout,
+		downloadSemaphore, sync.Mutex{}, 0, 0, sync.Mutex{}, jobsInFlight, cupsQueueSize, jpi, spi, jobFullUsername}
+
+	if err := pm.syncPrinters(); err != nil {
+		return nil, fmt.Errorf("initial printer sync failed: %s", err)
+	}
 
-	pm.syncPrinters()
+	pm.wg.Add(1)
 	go pm.syncPrintersPeriodically(printerPollInterval)
-	go pm.listenGCPJobs()
+	pm.wg.Add(1)
+	go pm.listenJobs()
+
+	if pvt != nil {
+		pm.wg.Add(1)
+		go pm.listenPrivetJobs()
+	}
+
+	if snmpManager != nil {
+		pm.wg.Add(1)
+		go pm.pollSNMPPeriodically()
+	}
+
+	if gcp != nil {
+		pm.wg.Add(1)
+		go pm.listenXMPPNotifications()
+
+		queuedJobs, err := pm.allGCPPrinters()
+		if err != nil {
+			return nil, err
+		}
+		for gcpID, count := range queuedJobs {
+			if count > 0 {
+				glog.Infof("Recovering %d queued job(s) for printer %s", count, gcpID)
+				pm.wg.Add(1)
+				go pm.handlePrinterNewJobs(gcpID)
+			}
+		}
+	}
 
 	return &pm, nil
 }
 
+// listenJobs drains the single job channel that cloud and local jobs are
+// multiplexed onto, spawning processJob for each, until quit is closed.
+func (pm *PrinterManager) listenJobs() {
+	defer pm.wg.Done()
+	for {
+		select {
+		case job := <-pm.jobs:
+			pm.wg.Add(1)
+			go pm.processJob(job)
+		case <-pm.quit:
+			return
+		}
+	}
+}
+
+// listenPrivetJobs forwards locally-submitted jobs onto the shared job
+// channel so they're processed identically to cloud jobs, until quit is
+// closed.
+func (pm *PrinterManager) listenPrivetJobs() {
+	defer pm.wg.Done()
+	for {
+		select {
+		case job := <-pm.privet.Jobs():
+			if !pm.startJob(job) {
+				glog.Warningf("Job %s is already in flight, ignoring duplicate delivery", job.GCPJobID)
+				continue
+			}
+			pm.jobs <- job
+		case <-pm.quit:
+			return
+		}
+	}
+}
+
+// allGCPPrinters returns the number of jobs queued for each of the proxy's
+// GCP printers, as reported by GCP's /list response. This lets the caller
+// recover jobs that arrived while the connector was down, since those jobs
+// won't generate a fresh XMPP notification.
+func (pm *PrinterManager) allGCPPrinters() (map[string]uint, error) {
+	gcpPrinters, err := pm.gcp.List()
+	if err != nil {
+		return nil, err
+	}
+	queuedJobs := make(map[string]uint, len(gcpPrinters))
+	for _, p := range gcpPrinters {
+		queuedJobs[p.GCPID] = p.QueuedJobsCount
+	}
+	return queuedJobs, nil
+}
+
+// Quit closes quit, which tells every poll loop to stop accepting new work,
+// then waits up to shutdownTimeout for in-flight jobs to finish. Anything
+// still recorded as in flight afterward — a job still running past the
+// timeout, or one that was fetched but never got as far as processJob
+// before listenJobs stopped dispatching — is forced to stop so users see a
+// failure instead of a job that hangs forever.
+//
+// Quit is never called automatically: whatever constructs a PrinterManager
+// is responsible for calling it on SIGINT/SIGTERM (e.g. via signal.Notify)
+// so the process doesn't just die with jobs mid-flight.
 func (pm *PrinterManager) Quit() {
-	pm.printerPollQuit <- true
-	<-pm.printerPollQuit
+	close(pm.quit)
+
+	done := make(chan struct{})
+	go func() {
+		pm.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(pm.shutdownTimeout):
+		glog.Warningf("Timed out after %s waiting for jobs to finish; stopping them", pm.shutdownTimeout)
+	}
+	pm.forceStopRemainingJobs()
+
+	if pm.xmpp != nil {
+		pm.xmpp.Quit()
+	}
+	if pm.privet != nil {
+		pm.privet.Quit()
+	}
+}
+
+// forceStopRemainingJobs reports every still-in-flight job as stopped by the
+// connector, so that callers waiting on job state don't hang forever. Called
+// unconditionally at the end of Quit: jobs that finished cleanly are already
+// gone from jobsInFlight by the time this runs, so it's a no-op for them.
+func (pm *PrinterManager) forceStopRemainingJobs() {
+	pm.jobsInFlightMutex.Lock()
+	defer pm.jobsInFlightMutex.Unlock()
+
+	for gcpJobID, job := range pm.jobsInFlight {
+		glog.Warningf("Forcing job %s to stop for shutdown", gcpJobID)
+		pm.control(job, stoppedByService(cdd.ServiceErrorOther))
+	}
 }
 
 func (pm *PrinterManager) syncPrintersPeriodically(printerPollInterval uint) {
+	defer pm.wg.Done()
+
 	interval := time.Duration(printerPollInterval) * time.Second
 	for {
 		select {
 		case <-time.After(interval):
-			pm.syncPrinters()
-		case <-pm.printerPollQuit:
-			pm.printerPollQuit <- true
+			if err := pm.syncPrinters(); err != nil {
+				glog.Errorf("Periodic printer sync failed: %s", err)
+			}
+		case <-pm.quit:
 			return
 		}
 	}
 }
 
-func printerMapToSlice(m map[string]lib.Printer) []lib.Printer {
-	s := make([]lib.Printer, 0, len(m))
-	for _, p := range m {
-		s = append(s, p)
+// pollSNMPPeriodically refreshes every known printer's SNMP-derived state on
+// its own interval, independent of CUPS attribute changes. applyDiff's
+// lib.UpdatePrinter case only fires when lib.DiffPrinters sees a CUPS-side
+// change, but a printer settles into lib.LeavePrinter as soon as it stops
+// changing there, and consumable levels and error conditions still need to
+// be kept fresh after that.
+func (pm *PrinterManager) pollSNMPPeriodically() {
+	defer pm.wg.Done()
+	for {
+		select {
+		case <-time.After(pm.snmpPollInterval):
+			pm.pollSNMP()
+		case <-pm.quit:
+			return
+		}
+	}
+}
+
+// pollSNMP refreshes and reports the SNMP-derived state of every printer
+// currently known to the connector.
+func (pm *PrinterManager) pollSNMP() {
+	for _, printer := range pm.gcpPrinters.GetAll() {
+		state, err := pm.snmp.Poll(printer.DeviceURI)
+		if err != nil {
+			glog.Warningf("Failed to poll SNMP state for %s: %s", printer.Name, err)
+			continue
+		}
+		printer.State = *state
+		pm.gcpPrinters.Set(printer)
+
+		if pm.gcp != nil {
+			diff := &lib.PrinterDiff{Operation: lib.LeavePrinter, Printer: printer}
+			if err := pm.gcp.Update(diff, ""); err != nil {
+				glog.Errorf("Failed to report SNMP state for %s: %s", printer.Name, err)
+			}
+		}
 	}
-	return s
 }
 
-func (pm *PrinterManager) syncPrinters() {
+func (pm *PrinterManager) syncPrinters() error {
 	glog.Info("Synchronizing printers, stand by")
 
 	cupsPrinters, err := pm.cups.GetPrinters()
 	if err != nil {
-		glog.Errorf("Sync failed while calling GetPrinters(): %s", err)
-		return
+		return fmt.Errorf("failed to call GetPrinters(): %s", err)
 	}
-	diffs := lib.DiffPrinters(cupsPrinters, printerMapToSlice(pm.gcpPrintersByGCPID))
+	diffs := lib.DiffPrinters(cupsPrinters, pm.gcpPrinters.GetAll())
 
 	if diffs == nil {
 		glog.Infof("Printers are already in sync; there are %d", len(cupsPrinters))
-		return
+		return nil
 	}
 
 	ch := make(chan lib.Printer)
 	for i := range diffs {
 		go pm.applyDiff(&diffs[i], ch)
 	}
-	currentPrinters := make(map[string]lib.Printer)
+	currentPrinters := make([]lib.Printer, 0, len(diffs))
 	for _ = range diffs {
 		p := <-ch
 		if p.Name != "" {
-			currentPrinters[p.GCPID] = p
+			currentPrinters = append(currentPrinters, p)
 		}
 	}
 
-	pm.gcpPrintersByGCPID = currentPrinters
+	pm.gcpPrinters.Refresh(currentPrinters)
 
 	glog.Infof("Finished synchronizing %d printers", len(currentPrinters))
+	return nil
 }
 
 func (pm *PrinterManager) applyDiff(diff *lib.PrinterDiff, ch chan<- lib.Printer) {
 	switch diff.Operation {
 	case lib.RegisterPrinter:
-		ppd, err := pm.cups.GetPPD(diff.Printer.Name)
-		if err != nil {
-			glog.Errorf("Failed to call GetPPD() while registering printer %s: %s",
-				diff.Printer.Name, err)
-			break
-		}
-		if err := pm.gcp.Register(&diff.Printer, ppd); err != nil {
-			glog.Errorf("Failed to register printer %s: %s", diff.Printer.Name, err)
-			break
+		var ppd string
+		if pm.gcp != nil || pm.privet != nil {
+			var err error
+			ppd, err = pm.cups.GetPPD(diff.Printer.Name)
+			if err != nil {
+				glog.Errorf("Failed to call GetPPD() while registering printer %s: %s",
+					diff.Printer.Name, err)
+				break
+			}
 		}
-		glog.Infof("Registered %s", diff.Printer.Name)
 
-		if pm.gcp.CanShare() {
-			if err := pm.gcp.Share(diff.Printer.GCPID); err != nil {
-				glog.Errorf("Failed to share printer %s: %s", diff.Printer.Name, err)
-			} else {
-				glog.Infof("Shared %s", diff.Printer.Name)
+		if pm.gcp != nil {
+			if err := pm.gcp.Register(&diff.Printer, ppd); err != nil {
+				glog.Errorf("Failed to register printer %s: %s", diff.Printer.Name, err)
+				break
+			}
+			glog.Infof("Registered %s", diff.Printer.Name)
+
+			if pm.gcp.CanShare() {
+				if err := pm.gcp.Share(diff.Printer.GCPID); err != nil {
+					glog.Errorf("Failed to share printer %s: %s", diff.Printer.Name, err)
+				} else {
+					glog.Infof("Shared %s", diff.Printer.Name)
+				}
 			}
 		}
 
 		diff.Printer.CUPSJobSemaphore = lib.NewSemaphore(pm.cupsQueueSize)
 
+		if pm.privet != nil {
+			if err := pm.privet.AddPrinter(diff.Printer, ppd); err != nil {
+				glog.Errorf("Failed to advertise printer %s over Privet: %s", diff.Printer.Name, err)
+			}
+		}
+
 		ch <- diff.Printer
 		return
 
@@ -171,19 +371,32 @@ func (pm *PrinterManager) applyDiff(diff *lib.PrinterDiff, ch chan<- lib.Printer
 			}
 		}
 
-		if err := pm.gcp.Update(diff, ppd); err != nil {
-			glog.Errorf("Failed to update a printer: %s", err)
-		} else {
-			glog.Infof("Updated %s", diff.Printer.Name)
+		if pm.gcp != nil {
+			if err := pm.gcp.Update(diff, ppd); err != nil {
+				glog.Errorf("Failed to update a printer: %s", err)
+			} else {
+				glog.Infof("Updated %s", diff.Printer.Name)
+			}
+		}
+
+		if pm.privet != nil {
+			if err := pm.privet.UpdatePrinter(diff.Printer, ppd); err != nil {
+				glog.Errorf("Failed to update Privet advertisement for %s: %s", diff.Printer.Name, err)
+			}
 		}
 
 		ch <- diff.Printer
 		return
 
 	case lib.DeletePrinter:
-		if err := pm.gcp.Delete(diff.Printer.GCPID); err != nil {
-			glog.Errorf("Failed to delete a printer %s: %s", diff.Printer.GCPID, err)
-			break
+		if pm.gcp != nil {
+			if err := pm.gcp.Delete(diff.Printer.GCPID); err != nil {
+				glog.Errorf("Failed to delete a printer %s: %s", diff.Printer.GCPID, err)
+				break
+			}
+		}
+		if pm.privet != nil {
+			pm.privet.DeletePrinter(diff.Printer.Name)
 		}
 		glog.Infof("Deleted %s", diff.Printer.Name)
 
@@ -196,34 +409,75 @@ func (pm *PrinterManager) applyDiff(diff *lib.PrinterDiff, ch chan<- lib.Printer
 	ch <- lib.Printer{}
 }
 
-func (pm *PrinterManager) listenGCPJobs() {
-	ch := make(chan *lib.Job)
-	go func() {
-		for {
-			jobs, err := pm.gcp.NextJobBatch()
-			if err != nil {
-				glog.Warningf("Error waiting for next printer: %s", err)
-			}
-			for _, job := range jobs {
-				ch <- &job
-			}
-		}
-	}()
-
+// listenXMPPNotifications replaces the old GCP job-polling loop: GCP pushes
+// a notification over XMPP whenever a printer gets a new job, and we react
+// by draining that printer's queue instead of spinning on NextJobBatch.
+func (pm *PrinterManager) listenXMPPNotifications() {
+	defer pm.wg.Done()
 	for {
 		select {
-		case job := <-ch:
-			go pm.processJob(job)
-		case <-pm.gcpJobPollQuit:
-			pm.gcpJobPollQuit <- true
+		case notification := <-pm.xmppNotifications:
+			pm.wg.Add(1)
+			go pm.handlePrinterNewJobs(notification.GCPID)
+		case <-pm.quit:
 			return
 		}
 	}
 }
 
+// handlePrinterNewJobs fetches and processes every job currently queued for
+// gcpID. It's called once per XMPP notification, and once at startup for
+// any printer that already had jobs queued before the connector came up.
+// Every call site tracks it with pm.wg so Quit waits for it, up to
+// shutdownTimeout, while it's still fetching jobs or blocked pushing onto
+// pm.jobs.
+func (pm *PrinterManager) handlePrinterNewJobs(gcpID string) {
+	defer pm.wg.Done()
+
+	jobs, err := pm.gcp.Fetch(gcpID)
+	if err != nil {
+		glog.Warningf("Error fetching jobs for printer %s: %s", gcpID, err)
+		return
+	}
+	for i := range jobs {
+		job := &jobs[i]
+		if !pm.startJob(job) {
+			glog.Warningf("Job %s is already in flight, ignoring duplicate delivery", job.GCPJobID)
+			continue
+		}
+		pm.jobs <- job
+	}
+}
+
+// startJob records job as in flight, returning false if it already was.
+// Called as soon as a job is pulled off GCP or Privet, before it's even
+// pushed onto pm.jobs, so that a job still sitting in that buffered channel
+// at shutdown is reported by forceStopRemainingJobs instead of silently
+// dropped. XMPP notifications and the startup queued-job sweep can both
+// deliver the same job, and GCP itself can double-deliver, so this also
+// keeps processJob from ever running twice for one job.
+func (pm *PrinterManager) startJob(job *lib.Job) bool {
+	pm.jobsInFlightMutex.Lock()
+	defer pm.jobsInFlightMutex.Unlock()
+
+	if _, inFlight := pm.jobsInFlight[job.GCPJobID]; inFlight {
+		return false
+	}
+	pm.jobsInFlight[job.GCPJobID] = job
+	return true
+}
+
+// finishJob clears gcpJobID's in-flight marker. Always called via defer from
+// processJob so the marker is cleared even when processJob returns early.
+func (pm *PrinterManager) finishJob(gcpJobID string) {
+	pm.jobsInFlightMutex.Lock()
+	defer pm.jobsInFlightMutex.Unlock()
+	delete(pm.jobsInFlight, gcpJobID)
+}
+
 func (pm *PrinterManager) incrementJobsProcessed(success bool) {
-	pm.jobStatsSemaphore.Acquire()
-	defer pm.jobStatsSemaphore.Release()
+	pm.jobStatsMutex.Lock()
+	defer pm.jobStatsMutex.Unlock()
 
 	if success {
 		pm.jobsDone += 1
@@ -232,56 +486,131 @@ func (pm *PrinterManager) incrementJobsProcessed(success bool) {
 	}
 }
 
-// 0) Gets a job's ticket (job options).
+// control reports a job's structured state to whichever source owns it: GCP
+// for cloud jobs, or the Privet job-state store for locally-submitted ones.
+func (pm *PrinterManager) control(job *lib.Job, diff cdd.PrintJobStateDiff) {
+	if job.PrivetJobID != "" {
+		if err := pm.privet.SetJobState(job.PrivetJobID, string(diff.State.Type)); err != nil {
+			glog.Warningf("Failed to update Privet job state for %s: %s", job.PrivetJobID, err)
+		}
+		return
+	}
+	if err := pm.gcp.Control(job.GCPJobID, diff); err != nil {
+		glog.Errorf("Failed to report state for job %s: %s", job.GCPJobID, err)
+	}
+}
+
+// abortedByService reports a job as aborted due to a failure in the
+// connector itself, as opposed to the device or the user.
+func abortedByService(errorCode cdd.ServiceErrorCode) cdd.PrintJobStateDiff {
+	return cdd.PrintJobStateDiff{
+		State: cdd.JobState{
+			Type:               cdd.JobStateAborted,
+			ServiceActionCause: &cdd.ServiceActionCause{ErrorCode: errorCode},
+		},
+	}
+}
+
+// stoppedByService reports a job as stopped by the connector itself, e.g.
+// because the connector is shutting down.
+func stoppedByService(errorCode cdd.ServiceErrorCode) cdd.PrintJobStateDiff {
+	return cdd.PrintJobStateDiff{
+		State: cdd.JobState{
+			Type:               cdd.JobStateStopped,
+			ServiceActionCause: &cdd.ServiceActionCause{ErrorCode: errorCode},
+		},
+	}
+}
+
+// stoppedByDevice reports a job as stalled by a blocking device condition,
+// e.g. the printer SNMP polling found it out of paper.
+func stoppedByDevice(errorCode cdd.ErrorCode) cdd.PrintJobStateDiff {
+	return cdd.PrintJobStateDiff{
+		State: cdd.JobState{
+			Type:              cdd.JobStateStopped,
+			DeviceActionCause: &cdd.DeviceActionCause{ErrorCode: errorCode},
+		},
+	}
+}
+
+// 0) Gets a job's ticket (job options), or for a locally-submitted job,
+//    the PDF it already arrived with.
 // 1) Downloads a new print job PDF to a temp file.
 // 2) Creates a new job in CUPS.
-// 3) Polls the CUPS job status to update the GCP job status.
-// 4) Returns when the job status is DONE or ERROR.
+// 3) Polls the CUPS job state to update the job's state at its source.
+// 4) Returns when the job state is DONE or ABORTED.
 // 5) Deletes temp file.
 func (pm *PrinterManager) processJob(job *lib.Job) {
+	defer pm.wg.Done()
 	glog.Infof("Received job %s", job.GCPJobID)
 
-	printer, exists := pm.gcpPrintersByGCPID[job.GCPPrinterID]
+	// job was already recorded as in flight by startJob when it was pulled
+	// off GCP or Privet, before being pushed onto pm.jobs.
+	defer pm.finishJob(job.GCPJobID)
+
+	var printer lib.Printer
+	var exists bool
+	if job.PrivetJobID != "" {
+		// Locally-submitted jobs carry the CUPS printer name, since a
+		// local-only printer may never have a GCPID at all.
+		printer, exists = pm.gcpPrinters.Get(job.GCPPrinterID)
+	} else {
+		printer, exists = pm.gcpPrinters.GetByGCPID(job.GCPPrinterID)
+	}
 	if !exists {
-		msg := fmt.Sprintf("Failed to find GCP printer %s for job %s", job.GCPPrinterID, job.GCPJobID)
-		glog.Error(msg)
-		pm.gcp.Control(job.GCPJobID, lib.JobError, msg)
+		glog.Errorf("Failed to find printer %s for job %s", job.GCPPrinterID, job.GCPJobID)
+		pm.control(job, abortedByService(cdd.ServiceErrorPrinterDeleted))
 		pm.incrementJobsProcessed(false)
 		return
 	}
 
-	options, err := pm.gcp.Ticket(job.TicketURL)
-	if err != nil {
-		msg := fmt.Sprintf("Failed to get a ticket for job %s: %s", job.GCPJobID, err)
-		glog.Error(msg)
-		pm.gcp.Control(job.GCPJobID, lib.JobError, msg)
+	if printer.State.JobState == cdd.JobStateStopped {
+		glog.Warningf("Not printing job %s: %s is reporting a blocking condition (%s)",
+			job.GCPJobID, printer.Name, printer.State.ErrorCode)
+		pm.control(job, stoppedByDevice(printer.State.ErrorCode))
 		pm.incrementJobsProcessed(false)
 		return
 	}
 
 	pdfFile, err := pm.cups.CreateTempFile()
 	if err != nil {
-		msg := fmt.Sprintf("Failed to create a temporary file for job %s: %s", job.GCPJobID, err)
-		glog.Error(msg)
-		pm.gcp.Control(job.GCPJobID, lib.JobError, msg)
+		glog.Errorf("Failed to create a temporary file for job %s: %s", job.GCPJobID, err)
+		pm.control(job, abortedByService(cdd.ServiceErrorOther))
 		pm.incrementJobsProcessed(false)
 		return
 	}
 
-	pm.downloadSemaphore.Acquire()
-	t := time.Now()
-	err = pm.gcp.Download(pdfFile, job.FileURL)
-	dt := time.Now().Sub(t)
-	pm.downloadSemaphore.Release()
-	if err != nil {
-		msg := fmt.Sprintf("Failed to download PDF for job %s: %s", job.GCPJobID, err)
-		glog.Error(msg)
-		pm.gcp.Control(job.GCPJobID, lib.JobError, msg)
-		pm.incrementJobsProcessed(false)
-		return
-	}
+	var options string
+	if job.PrivetJobID != "" {
+		if _, err := pdfFile.Write(job.PDF); err != nil {
+			glog.Errorf("Failed to write local PDF for job %s: %s", job.GCPJobID, err)
+			pm.control(job, abortedByService(cdd.ServiceErrorOther))
+			pm.incrementJobsProcessed(false)
+			return
+		}
+	} else {
+		options, err = pm.gcp.Ticket(job.TicketURL)
+		if err != nil {
+			glog.Errorf("Failed to get a ticket for job %s: %s", job.GCPJobID, err)
+			pm.control(job, abortedByService(cdd.ServiceErrorInvalidTicket))
+			pm.incrementJobsProcessed(false)
+			return
+		}
 
-	glog.Infof("Downloaded job %s in %s", job.GCPJobID, dt.String())
+		pm.downloadSemaphore.Acquire()
+		t := time.Now()
+		err = pm.gcp.Download(pdfFile, job.FileURL)
+		dt := time.Now().Sub(t)
+		pm.downloadSemaphore.Release()
+		if err != nil {
+			glog.Errorf("Failed to download PDF for job %s: %s", job.GCPJobID, err)
+			pm.control(job, abortedByService(cdd.ServiceErrorOther))
+			pm.incrementJobsProcessed(false)
+			return
+		}
+
+		glog.Infof("Downloaded job %s in %s", job.GCPJobID, dt.String())
+	}
 	pdfFile.Close()
 	defer os.Remove(pdfFile.Name())
 
@@ -292,37 +621,47 @@ func (pm *PrinterManager) processJob(job *lib.Job) {
 
 	cupsJobID, err := pm.cups.Print(printer.Name, pdfFile.Name(), "gcp:"+job.GCPJobID, ownerID, options)
 	if err != nil {
-		msg := fmt.Sprintf("Failed to send job %s to CUPS: %s", job.GCPJobID, err)
-		glog.Error(msg)
-		pm.gcp.Control(job.GCPJobID, lib.JobError, msg)
+		glog.Errorf("Failed to send job %s to CUPS: %s", job.GCPJobID, err)
+		pm.control(job, abortedByService(cdd.ServiceErrorOther))
 		pm.incrementJobsProcessed(false)
 		return
 	}
 
 	glog.Infof("Submitted GCP job %s as CUPS job %d", job.GCPJobID, cupsJobID)
 
-	status := ""
-	message := ""
+	var lastDiff cdd.PrintJobStateDiff
+
+	ticker := time.NewTicker(pm.jobPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pm.quit:
+			// Shutting down: report this job as stopped and stop polling.
+			// Returning clears its in-flight marker, so
+			// forceStopRemainingJobs won't report it a second time.
+			pm.control(job, stoppedByService(cdd.ServiceErrorOther))
+			pm.incrementJobsProcessed(false)
+			return
+		case <-ticker.C:
+		}
 
-	for _ = range time.Tick(pm.jobPollInterval) {
-		latestStatus, latestMessage, err := pm.cups.GetJobStatus(cupsJobID)
+		latestDiff, err := pm.cups.GetJobStatus(cupsJobID)
 		if err != nil {
-			msg := fmt.Sprintf("Failed to get status of CUPS job %d: %s", cupsJobID, err)
-			glog.Error(msg)
-			pm.gcp.Control(job.GCPJobID, lib.JobError, msg)
+			glog.Errorf("Failed to get status of CUPS job %d: %s", cupsJobID, err)
+			pm.control(job, abortedByService(cdd.ServiceErrorOther))
 			pm.incrementJobsProcessed(false)
 			return
 		}
 
-		if latestStatus.GCPStatus() != status || latestMessage != message {
-			status = latestStatus.GCPStatus()
-			message = latestMessage
-			pm.gcp.Control(job.GCPJobID, status, message)
-			glog.Infof("Job %s status is now: %s", job.GCPJobID, status)
+		if !reflect.DeepEqual(latestDiff, lastDiff) {
+			lastDiff = latestDiff
+			pm.control(job, latestDiff)
+			glog.Infof("Job %s state is now: %s", job.GCPJobID, latestDiff.State.Type)
 		}
 
-		if latestStatus.GCPStatus() != lib.JobInProgress {
-			if latestStatus.GCPStatus() == lib.JobDone {
+		if latestDiff.State.Type == cdd.JobStateDone || latestDiff.State.Type == cdd.JobStateAborted {
+			if latestDiff.State.Type == cdd.JobStateDone {
 				pm.incrementJobsProcessed(true)
 			} else {
 				pm.incrementJobsProcessed(false)
@@ -335,7 +674,7 @@ func (pm *PrinterManager) processJob(job *lib.Job) {
 func (pm *PrinterManager) GetJobStats() (uint, uint, error) {
 	var processed, processing uint
 
-	for _, printer := range pm.gcpPrintersByGCPID {
+	for _, printer := range pm.gcpPrinters.GetAll() {
 		processing += printer.CUPSJobSemaphore.Count()
 	}
 
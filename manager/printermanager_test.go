@@ -0,0 +1,75 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package manager
+
+import (
+	"sync"
+	"testing"
+
+	"cups-connector/lib"
+)
+
+func newTestPrinterManager() *PrinterManager {
+	return &PrinterManager{jobsInFlight: make(map[string]*lib.Job)}
+}
+
+func TestStartJobRejectsDuplicate(t *testing.T) {
+	pm := newTestPrinterManager()
+	job := &lib.Job{GCPJobID: "job1"}
+
+	if !pm.startJob(job) {
+		t.Fatal("startJob should succeed the first time a job is seen")
+	}
+	if pm.startJob(job) {
+		t.Fatal("startJob should reject a job that's already in flight")
+	}
+
+	pm.finishJob(job.GCPJobID)
+	if !pm.startJob(job) {
+		t.Fatal("startJob should succeed again once finishJob has cleared the marker")
+	}
+}
+
+// TestStartJobConcurrentDuplicates guards against the double-print bug this
+// was written to fix: XMPP notifications and the startup queued-job sweep
+// can both deliver the same GCPJobID at the same moment, and only one of
+// them should win.
+func TestStartJobConcurrentDuplicates(t *testing.T) {
+	pm := newTestPrinterManager()
+	job := &lib.Job{GCPJobID: "job1"}
+
+	var wg sync.WaitGroup
+	var successMutex sync.Mutex
+	successes := 0
+
+	const attempts = 50
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if pm.startJob(job) {
+				successMutex.Lock()
+				successes++
+				successMutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if successes != 1 {
+		t.Fatalf("expected exactly 1 of %d concurrent startJob calls to succeed, got %d", attempts, successes)
+	}
+}
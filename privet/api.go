@@ -0,0 +1,98 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package privet
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+
+	"cups-connector/lib"
+)
+
+// handleInfo answers GET /privet/info with the printer's identity, as
+// required before a client is allowed to call any other endpoint.
+func (pp *privetPrinter) handleInfo(w http.ResponseWriter, r *http.Request) {
+	printer, _ := pp.snapshot()
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"version": "1.0",
+		"name":    printer.Name,
+		"id":      printer.GCPID,
+		"type":    []string{"printer"},
+	})
+}
+
+// handleAccessToken answers GET /privet/accesstoken. Local printing doesn't
+// need an OAuth token, so this always grants a no-op privet token.
+func (pp *privetPrinter) handleAccessToken(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]string{"access_token": "privet_token", "token_type": "Privet"})
+}
+
+// handleCapabilities answers GET /privet/capabilities with the PPD this
+// printer was registered with, so a client can build a print ticket from it.
+func (pp *privetPrinter) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	_, ppd := pp.snapshot()
+	w.Write([]byte(ppd))
+}
+
+// handleCreateJob answers POST /privet/printer/createjob by minting a new
+// Privet job ID that the client will submit the document against next.
+func (pp *privetPrinter) handleCreateJob(w http.ResponseWriter, r *http.Request) {
+	privetJobID := pp.jobStore.newJob()
+	json.NewEncoder(w).Encode(map[string]string{"job_id": privetJobID})
+}
+
+// handleSubmitDoc answers POST /privet/printer/submitdoc. The body is a PDF
+// which gets handed off to the connector exactly like a cloud job.
+func (pp *privetPrinter) handleSubmitDoc(w http.ResponseWriter, r *http.Request) {
+	privetJobID := r.URL.Query().Get("job_id")
+	if !pp.jobStore.has(privetJobID) {
+		pp.logError(w, http.StatusNotFound, "unknown job_id %s", privetJobID)
+		return
+	}
+
+	data, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		pp.logError(w, http.StatusBadRequest, "failed to read document: %s", err)
+		return
+	}
+
+	printer, _ := pp.snapshot()
+	pp.jobStore.setState(privetJobID, lib.JobInProgress)
+	pp.jobs <- &lib.Job{
+		// GCPPrinterID holds the CUPS printer name for locally-submitted
+		// jobs, since printer.GCPID may be empty in local-only mode.
+		GCPPrinterID: printer.Name,
+		GCPJobID:     privetJobID,
+		PrivetJobID:  privetJobID,
+		PDF:          data,
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"job_id": privetJobID})
+}
+
+// handleJobState answers GET /privet/printer/jobstate so that the submitting
+// client can poll for completion.
+func (pp *privetPrinter) handleJobState(w http.ResponseWriter, r *http.Request) {
+	privetJobID := r.URL.Query().Get("job_id")
+	state, ok := pp.jobStore.state(privetJobID)
+	if !ok {
+		pp.logError(w, http.StatusNotFound, "unknown job_id %s", privetJobID)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"state": state})
+}
@@ -0,0 +1,72 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package privet
+
+import (
+	"strconv"
+	"sync"
+
+	"cups-connector/lib"
+)
+
+// jobStore tracks the state of jobs submitted to one printer over Privet, so
+// that /privet/printer/jobstate has something to report. printerName is
+// baked into every ID this store hands out, since a Privet job ID doubles
+// as the job's GCPJobID, and two printers' per-printer counters would
+// otherwise both start handing out "1".
+type jobStore struct {
+	mutex       sync.Mutex
+	printerName string
+	nextID      uint64
+	states      map[string]string
+}
+
+func newJobStore(printerName string) *jobStore {
+	return &jobStore{printerName: printerName, states: make(map[string]string)}
+}
+
+// newJob allocates a new, globally-unique Privet job ID in
+// lib.JobInProgress state.
+func (js *jobStore) newJob() string {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+
+	js.nextID++
+	id := js.printerName + "-" + strconv.FormatUint(js.nextID, 10)
+	js.states[id] = lib.JobInProgress
+	return id
+}
+
+func (js *jobStore) has(privetJobID string) bool {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	_, exists := js.states[privetJobID]
+	return exists
+}
+
+func (js *jobStore) state(privetJobID string) (string, bool) {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	state, exists := js.states[privetJobID]
+	return state, exists
+}
+
+func (js *jobStore) setState(privetJobID string, state string) {
+	js.mutex.Lock()
+	defer js.mutex.Unlock()
+	js.states[privetJobID] = state
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package privet
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+
+	"cups-connector/lib"
+
+	"github.com/golang/glog"
+	"github.com/hashicorp/mdns"
+)
+
+const privetServiceType = "_privet._tcp"
+
+// privetPrinter is the mDNS service and HTTP server backing one locally
+// advertised printer.
+type privetPrinter struct {
+	mutex   sync.Mutex
+	printer lib.Printer
+	ppd     string
+
+	port int
+
+	mdnsServer *mdns.Server
+	listener   net.Listener
+	jobStore   *jobStore
+	jobs       chan<- *lib.Job
+}
+
+// newPrivetPrinter starts serving printer's Privet API on an OS-assigned
+// port. Letting the kernel pick, rather than handing out ports from a
+// counter, means a printer that's deleted and re-added, or churn across many
+// printers over the connector's lifetime, can never exhaust or wrap back
+// into low/system ports. ppd is the printer's capabilities document, served
+// back from /privet/capabilities.
+func newPrivetPrinter(printer lib.Printer, ppd string, jobs chan<- *lib.Job) (*privetPrinter, error) {
+	pp := &privetPrinter{
+		printer:  printer,
+		ppd:      ppd,
+		jobStore: newJobStore(printer.Name),
+		jobs:     jobs,
+	}
+
+	listener, err := net.Listen("tcp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	pp.listener = listener
+	pp.port = listener.Addr().(*net.TCPAddr).Port
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/privet/info", pp.handleInfo)
+	mux.HandleFunc("/privet/accesstoken", pp.handleAccessToken)
+	mux.HandleFunc("/privet/capabilities", pp.handleCapabilities)
+	mux.HandleFunc("/privet/printer/createjob", pp.handleCreateJob)
+	mux.HandleFunc("/privet/printer/submitdoc", pp.handleSubmitDoc)
+	mux.HandleFunc("/privet/printer/jobstate", pp.handleJobState)
+	go http.Serve(listener, mux)
+
+	service, err := mdns.NewMDNSService(printer.Name, privetServiceType, "", "", pp.port, nil, pp.txtRecords())
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	server, err := mdns.NewServer(&mdns.Config{Zone: service})
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	pp.mdnsServer = server
+
+	return pp, nil
+}
+
+// snapshot returns the most recently stored printer and ppd, safe to call
+// concurrently with update() from the HTTP handler goroutines that serve
+// them.
+func (pp *privetPrinter) snapshot() (lib.Printer, string) {
+	pp.mutex.Lock()
+	defer pp.mutex.Unlock()
+	return pp.printer, pp.ppd
+}
+
+// txtRecords builds the DNS-SD TXT records required by the Privet spec.
+func (pp *privetPrinter) txtRecords() []string {
+	printer, _ := pp.snapshot()
+	cs := "offline"
+	if printer.GCPID != "" {
+		cs = "online"
+	}
+	return []string{
+		"ty=" + printer.Name,
+		"note=" + printer.DefaultDisplayName,
+		"url=/privet/info",
+		"type=printer",
+		"id=" + printer.GCPID,
+		"cs=" + cs,
+	}
+}
+
+// update re-advertises pp with a fresh set of TXT records, e.g. after the
+// printer is registered with GCP and gets a GCPID. mdns.Server has no
+// supported way to mutate its zone in place, so this tears down the old
+// server and stands up a new one with the refreshed records. ppd is only
+// non-empty when the printer's capabilities actually changed, so an empty
+// ppd leaves the previously-stored capabilities in place.
+func (pp *privetPrinter) update(printer lib.Printer, ppd string) error {
+	pp.mutex.Lock()
+	pp.printer = printer
+	if ppd != "" {
+		pp.ppd = ppd
+	}
+	pp.mutex.Unlock()
+
+	service, err := mdns.NewMDNSService(printer.Name, privetServiceType, "", "", pp.port, nil, pp.txtRecords())
+	if err != nil {
+		return err
+	}
+	server, err := mdns.NewServer(&mdns.Config{Zone: service})
+	if err != nil {
+		return err
+	}
+
+	old := pp.mdnsServer
+	pp.mdnsServer = server
+	if old != nil {
+		old.Shutdown()
+	}
+	return nil
+}
+
+func (pp *privetPrinter) quit() {
+	if pp.mdnsServer != nil {
+		pp.mdnsServer.Shutdown()
+	}
+	if pp.listener != nil {
+		pp.listener.Close()
+	}
+}
+
+func (pp *privetPrinter) logError(w http.ResponseWriter, status int, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	glog.Warningf("privet: %s", msg)
+	http.Error(w, msg, status)
+}
@@ -0,0 +1,130 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package privet lets the connector offer each CUPS printer over the LAN
+// via Privet local discovery and printing, so that printing keeps working
+// when the connector can't reach Google Cloud Print.
+package privet
+
+import (
+	"fmt"
+	"sync"
+
+	"cups-connector/lib"
+
+	"github.com/golang/glog"
+)
+
+// Privet advertises and serves every local printer that's been added to it.
+// A single Privet handles all printers; each printer gets its own mDNS
+// service and HTTP server so it can be discovered and printed to
+// independently.
+type Privet struct {
+	jobs chan *lib.Job
+
+	mutex    sync.Mutex
+	printers map[string]*privetPrinter // keyed by CUPS printer name
+}
+
+// NewPrivet constructs an empty Privet. Call AddPrinter for each printer
+// that should be advertised locally.
+func NewPrivet() *Privet {
+	return &Privet{
+		jobs:     make(chan *lib.Job, 10),
+		printers: make(map[string]*privetPrinter),
+	}
+}
+
+// Jobs returns the channel that locally-submitted print jobs arrive on.
+// Callers should treat these exactly like jobs received from GCP.
+func (pv *Privet) Jobs() <-chan *lib.Job {
+	return pv.jobs
+}
+
+// AddPrinter starts advertising printer over mDNS and serving its Privet API
+// on an OS-assigned port. printer.GCPID is empty when the printer isn't
+// registered with GCP yet. ppd is the printer's capabilities document.
+func (pv *Privet) AddPrinter(printer lib.Printer, ppd string) error {
+	pv.mutex.Lock()
+	defer pv.mutex.Unlock()
+
+	if _, exists := pv.printers[printer.Name]; exists {
+		return fmt.Errorf("privet: printer %s is already advertised", printer.Name)
+	}
+
+	pp, err := newPrivetPrinter(printer, ppd, pv.jobs)
+	if err != nil {
+		return fmt.Errorf("privet: failed to advertise printer %s: %s", printer.Name, err)
+	}
+
+	pv.printers[printer.Name] = pp
+	glog.Infof("Advertising %s locally via Privet on port %d", printer.Name, pp.port)
+	return nil
+}
+
+// UpdatePrinter refreshes the advertised state (GCP ID, online/offline,
+// capabilities) of an already-added printer. ppd is only non-empty when the
+// printer's capabilities actually changed.
+func (pv *Privet) UpdatePrinter(printer lib.Printer, ppd string) error {
+	pv.mutex.Lock()
+	defer pv.mutex.Unlock()
+
+	pp, exists := pv.printers[printer.Name]
+	if !exists {
+		return fmt.Errorf("privet: printer %s is not advertised", printer.Name)
+	}
+	return pp.update(printer, ppd)
+}
+
+// DeletePrinter stops advertising and serving name.
+func (pv *Privet) DeletePrinter(name string) {
+	pv.mutex.Lock()
+	defer pv.mutex.Unlock()
+
+	if pp, exists := pv.printers[name]; exists {
+		pp.quit()
+		delete(pv.printers, name)
+		glog.Infof("Stopped advertising %s via Privet", name)
+	}
+}
+
+// SetJobState records the latest CUPS-derived state for a job that was
+// submitted locally, so that a subsequent /privet/printer/jobstate poll from
+// the submitting client sees it.
+func (pv *Privet) SetJobState(privetJobID string, state string) error {
+	pv.mutex.Lock()
+	defer pv.mutex.Unlock()
+
+	for _, pp := range pv.printers {
+		if pp.jobStore.has(privetJobID) {
+			pp.jobStore.setState(privetJobID, state)
+			return nil
+		}
+	}
+	return fmt.Errorf("privet: unknown job %s", privetJobID)
+}
+
+// Quit stops advertising and serving all printers.
+func (pv *Privet) Quit() {
+	pv.mutex.Lock()
+	defer pv.mutex.Unlock()
+
+	for name, pp := range pv.printers {
+		pp.quit()
+		delete(pv.printers, name)
+	}
+	close(pv.jobs)
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package snmp polls printers' Printer-MIB OIDs for consumable levels and
+// error state, and turns the result into a cdd.PrinterStateSection that the
+// connector can report alongside a printer's capabilities.
+package snmp
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"cups-connector/cdd"
+	"cups-connector/lib"
+
+	"github.com/golang/glog"
+	"github.com/soniah/gosnmp"
+)
+
+// Printer-MIB (RFC 3805) OIDs, walked once per poll.
+const (
+	oidMarkerSuppliesLevel       = "1.3.6.1.2.1.43.11.1.1.9"
+	oidMarkerSuppliesMaxCapacity = "1.3.6.1.2.1.43.11.1.1.8"
+	oidInputCurrentLevel         = "1.3.6.1.2.1.43.8.2.1.10"
+	oidAlertDescription          = "1.3.6.1.2.1.43.18.1.1.8"
+	oidDetectedErrorState        = "1.3.6.1.2.1.25.3.5.1.2"
+)
+
+// SNMPManager polls printers for their Printer-MIB state, bounding the
+// number of devices polled concurrently.
+type SNMPManager struct {
+	community string
+	semaphore *lib.Semaphore
+}
+
+// NewSNMPManager constructs an SNMPManager that authenticates with
+// community and never has more than maxConnections polls in flight.
+func NewSNMPManager(community string, maxConnections uint) *SNMPManager {
+	return &SNMPManager{
+		community: community,
+		semaphore: lib.NewSemaphore(maxConnections),
+	}
+}
+
+// Poll queries deviceURI (e.g. "socket://host", "ipp://host:631/printers/x")
+// for its current consumable and error state.
+func (sm *SNMPManager) Poll(deviceURI string) (*cdd.PrinterStateSection, error) {
+	host, err := hostFromDeviceURI(deviceURI)
+	if err != nil {
+		return nil, err
+	}
+
+	sm.semaphore.Acquire()
+	defer sm.semaphore.Release()
+
+	gs := &gosnmp.GoSNMP{
+		Target:    host,
+		Port:      161,
+		Community: sm.community,
+		Version:   gosnmp.Version2c,
+		Timeout:   defaultTimeout,
+	}
+	if err := gs.Connect(); err != nil {
+		return nil, fmt.Errorf("snmp: failed to connect to %s: %s", host, err)
+	}
+	defer gs.Conn.Close()
+
+	state := &cdd.PrinterStateSection{}
+
+	levels, err := walkInt(gs, oidMarkerSuppliesLevel)
+	if err != nil {
+		return nil, err
+	}
+	maxCapacities, err := walkUint(gs, oidMarkerSuppliesMaxCapacity)
+	if err != nil {
+		return nil, err
+	}
+	for i, level := range levels {
+		if level < 0 {
+			// -1 ("unknown") or -2 ("some remains, unknown amount"): the
+			// printer can't report an exact level, so don't guess one.
+			state.Markers = append(state.Markers, cdd.MarkerState{LevelPercent: -1, State: "OK"})
+			continue
+		}
+		max := uint(100)
+		if i < len(maxCapacities) && maxCapacities[i] > 0 {
+			max = maxCapacities[i]
+		}
+		state.Markers = append(state.Markers, cdd.MarkerState{
+			LevelPercent: int(uint(level) * 100 / max),
+			State:        markerState(uint(level), max),
+		})
+	}
+
+	trayLevels, err := walkInt(gs, oidInputCurrentLevel)
+	if err != nil {
+		return nil, err
+	}
+	for _, level := range trayLevels {
+		if level < 0 {
+			state.InputTrays = append(state.InputTrays, cdd.InputTrayState{LevelPercent: -1, State: "OK"})
+			continue
+		}
+		state.InputTrays = append(state.InputTrays, cdd.InputTrayState{
+			LevelPercent: int(level),
+			State:        markerState(uint(level), 100),
+		})
+	}
+
+	alerts, err := walkString(gs, oidAlertDescription)
+	if err != nil {
+		return nil, err
+	}
+	state.VendorState = alerts
+
+	errorStates, err := walkUint(gs, oidDetectedErrorState)
+	if err != nil {
+		return nil, err
+	}
+	state.JobState, state.ErrorCode = rollUpState(alerts, errorStates)
+
+	return state, nil
+}
+
+func hostFromDeviceURI(deviceURI string) (string, error) {
+	u, err := url.Parse(deviceURI)
+	if err != nil {
+		return "", fmt.Errorf("snmp: failed to parse device URI %s: %s", deviceURI, err)
+	}
+	host := u.Hostname()
+	if host == "" {
+		return "", fmt.Errorf("snmp: device URI %s has no host to poll", deviceURI)
+	}
+	return host, nil
+}
+
+func markerState(level, max uint) string {
+	if level == 0 {
+		return "EXHAUSTED"
+	}
+	if level*100/max < 10 {
+		return "LOW"
+	}
+	return "OK"
+}
+
+// rollUpState inspects the vendor alert strings and
+// hrPrinterDetectedErrorState bits for conditions severe enough to stall a
+// job.
+func rollUpState(alerts []string, errorStates []uint) (cdd.JobStateType, cdd.ErrorCode) {
+	for _, alert := range alerts {
+		lower := strings.ToLower(alert)
+		switch {
+		case strings.Contains(lower, "toner"):
+			return cdd.JobStateStopped, cdd.ErrorNoToner
+		case strings.Contains(lower, "door") || strings.Contains(lower, "cover"):
+			return cdd.JobStateStopped, cdd.ErrorDoorOpen
+		case strings.Contains(lower, "jam"):
+			return cdd.JobStateStopped, cdd.ErrorJammed
+		case strings.Contains(lower, "paper"):
+			return cdd.JobStateStopped, cdd.ErrorOutOfPaper
+		}
+	}
+	for _, es := range errorStates {
+		if es != 0 {
+			glog.Warningf("snmp: hrPrinterDetectedErrorState reports an error (%d) with no matching alert text", es)
+			return cdd.JobStateStopped, ""
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package snmp
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/soniah/gosnmp"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// walkUint walks oid and returns each returned value coerced to uint, in
+// table order.
+func walkUint(gs *gosnmp.GoSNMP, oid string) ([]uint, error) {
+	var values []uint
+	err := gs.Walk(oid, func(pdu gosnmp.SnmpPDU) error {
+		v := gosnmp.ToBigInt(pdu.Value)
+		if v == nil {
+			return fmt.Errorf("snmp: unexpected value type for %s", pdu.Name)
+		}
+		values = append(values, uint(v.Uint64()))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snmp: failed to walk %s: %s", oid, err)
+	}
+	return values, nil
+}
+
+// walkInt walks oid and returns each returned value as its signed int64
+// form, in table order. Printer-MIB markers and trays commonly report the
+// negative sentinels -1 ("unknown") and -2 ("some remains, unknown amount")
+// in place of an exact level, so callers that need to tell those apart from
+// a real level must use this instead of walkUint, which would coerce them
+// into a small positive magnitude.
+func walkInt(gs *gosnmp.GoSNMP, oid string) ([]int64, error) {
+	var values []int64
+	err := gs.Walk(oid, func(pdu gosnmp.SnmpPDU) error {
+		v := gosnmp.ToBigInt(pdu.Value)
+		if v == nil {
+			return fmt.Errorf("snmp: unexpected value type for %s", pdu.Name)
+		}
+		values = append(values, v.Int64())
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snmp: failed to walk %s: %s", oid, err)
+	}
+	return values, nil
+}
+
+// walkString walks oid and returns each returned value as a string, in
+// table order.
+func walkString(gs *gosnmp.GoSNMP, oid string) ([]string, error) {
+	var values []string
+	err := gs.Walk(oid, func(pdu gosnmp.SnmpPDU) error {
+		if b, ok := pdu.Value.([]byte); ok {
+			values = append(values, string(b))
+		} else {
+			values = append(values, fmt.Sprintf("%v", pdu.Value))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("snmp: failed to walk %s: %s", oid, err)
+	}
+	return values, nil
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2014 Google Inc. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package xmpp maintains a persistent connection to talk.google.com and
+// translates GCP's cloudprint notification stanzas into PrinterNotification
+// events, so that the connector can react to new jobs instead of polling for
+// them.
+package xmpp
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+	xmppclient "github.com/mattn/go-xmpp"
+)
+
+const (
+	xmppServer = "talk.google.com:443"
+
+	// cloudprint notifications arrive as pubsub-style messages whose body
+	// is this prefix followed by the GCP ID of the printer with a new job.
+	notificationPrefix = "/cloudprint/"
+)
+
+// PrinterNotification is emitted whenever GCP pushes a new-job notification
+// for a printer.
+type PrinterNotification struct {
+	GCPID string
+}
+
+// Client keeps a persistent, authenticated XMPP session alive and converts
+// incoming notification stanzas into PrinterNotification events.
+type Client struct {
+	proxyName    string
+	user         string
+	password     string
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+
+	notifications chan PrinterNotification
+
+	quit chan struct{}
+	wg   sync.WaitGroup
+
+	mutex sync.Mutex
+	conn  *xmppclient.Client
+}
+
+// NewClient opens an authenticated XMPP session for user and starts a
+// keep-alive ping loop. It sends no subscription stanza, so only
+// notifications the server delivers to the session unrequested are seen;
+// proxyName is stored but not used in the session. The returned channel is
+// closed when Quit is called.
+func NewClient(user, password, proxyName string, pingInterval, pingTimeout time.Duration) (*Client, <-chan PrinterNotification, error) {
+	c := &Client{
+		proxyName:     proxyName,
+		user:          user,
+		password:      password,
+		pingInterval:  pingInterval,
+		pingTimeout:   pingTimeout,
+		notifications: make(chan PrinterNotification, 10),
+		quit:          make(chan struct{}),
+	}
+
+	if err := c.connect(); err != nil {
+		return nil, nil, err
+	}
+
+	c.wg.Add(1)
+	go c.listen()
+
+	return c, c.notifications, nil
+}
+
+func (c *Client) connect() error {
+	options := xmppclient.Options{
+		Host:     xmppServer,
+		User:     c.user,
+		Password: c.password,
+		NoTLS:    false,
+		Debug:    false,
+	}
+
+	conn, err := options.NewClient()
+	if err != nil {
+		return fmt.Errorf("xmpp: failed to connect to %s: %s", xmppServer, err)
+	}
+
+	c.mutex.Lock()
+	old := c.conn
+	c.conn = conn
+	c.mutex.Unlock()
+	if old != nil {
+		old.Close()
+	}
+
+	glog.Infof("xmpp: connected as %s", c.user)
+	return nil
+}
+
+// listen reads stanzas off the connection until Quit is called, reconnecting
+// whenever the ping loop or the connection itself fails.
+func (c *Client) listen() {
+	defer c.wg.Done()
+
+	pingQuit := make(chan struct{})
+	go c.pingLoop(pingQuit)
+
+	for {
+		select {
+		case <-c.quit:
+			close(pingQuit)
+			c.mutex.Lock()
+			if c.conn != nil {
+				c.conn.Close()
+			}
+			c.mutex.Unlock()
+			close(c.notifications)
+			return
+		default:
+		}
+
+		c.mutex.Lock()
+		conn := c.conn
+		c.mutex.Unlock()
+
+		chat, err := conn.Recv()
+		if err != nil {
+			glog.Warningf("xmpp: lost connection, reconnecting: %s", err)
+			c.reconnect()
+			continue
+		}
+
+		if notification, ok := parseNotification(chat); ok {
+			c.notifications <- notification
+		}
+	}
+}
+
+// parseNotification extracts a PrinterNotification from a cloudprint pubsub
+// message stanza, if that's what chat is.
+func parseNotification(chat interface{}) (PrinterNotification, bool) {
+	msg, ok := chat.(xmppclient.Chat)
+	if !ok || msg.Type != "headline" {
+		return PrinterNotification{}, false
+	}
+	if !strings.HasPrefix(msg.Text, notificationPrefix) {
+		return PrinterNotification{}, false
+	}
+	gcpID := strings.TrimPrefix(msg.Text, notificationPrefix)
+	if gcpID == "" {
+		return PrinterNotification{}, false
+	}
+	return PrinterNotification{GCPID: gcpID}, true
+}
+
+// pingLoop sends a keep-alive ping every pingInterval and forces a reconnect
+// if sending it fails or doesn't complete within pingTimeout. The server's
+// reply to the ping is not waited for.
+func (c *Client) pingLoop(quit <-chan struct{}) {
+	ticker := time.NewTicker(c.pingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.mutex.Lock()
+			conn := c.conn
+			c.mutex.Unlock()
+
+			result := make(chan error, 1)
+			go func() { result <- conn.PingC2S("", "") }()
+
+			select {
+			case err := <-result:
+				if err != nil {
+					glog.Warningf("xmpp: ping failed, reconnecting: %s", err)
+					c.reconnect()
+				}
+			case <-time.After(c.pingTimeout):
+				glog.Warningf("xmpp: ping timed out after %s, reconnecting", c.pingTimeout)
+				c.reconnect()
+			}
+
+		case <-quit:
+			return
+		}
+	}
+}
+
+func (c *Client) reconnect() {
+	c.mutex.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.mutex.Unlock()
+
+	for {
+		select {
+		case <-c.quit:
+			return
+		default:
+		}
+
+		if err := c.connect(); err != nil {
+			glog.Errorf("xmpp: reconnect failed, retrying in 5s: %s", err)
+			time.Sleep(5 * time.Second)
+			continue
+		}
+		return
+	}
+}
+
+// Quit closes the XMPP session and stops the ping and listen loops. listen's
+// blocking Recv call won't notice c.quit on its own until the connection
+// happens to return, so Quit force-closes the live connection directly to
+// unblock it immediately.
+func (c *Client) Quit() {
+	close(c.quit)
+
+	c.mutex.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.mutex.Unlock()
+
+	c.wg.Wait()
+}